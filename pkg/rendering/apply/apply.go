@@ -0,0 +1,190 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package apply installs the resources produced by pkg/rendering in
+// dependency order instead of template order.
+package apply
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("apply")
+
+// fieldManager is the fixed field manager used for every server-side apply.
+const fieldManager = "multiclusterhub-operator"
+
+// Annotation keys read off each resource to control how/when it's applied.
+// These must stay in sync with rendering.AnnotationApplyMode/AnnotationHook -
+// duplicated here rather than imported to keep apply a leaf package that
+// rendering depends on, not the other way around.
+const (
+	annotationApplyMode = "mch.open-cluster-management.io/apply-mode"
+	annotationHook      = "mch.open-cluster-management.io/hook"
+)
+
+// crdEstablishedTimeout bounds how long Apply waits for a CRD's Established condition.
+const crdEstablishedTimeout = 60 * time.Second
+
+// phase groups kinds that can be applied together; Apply blocks until every
+// object in a phase is applied (and, for CRDs, Established) before moving on
+// to the next phase.
+type phase struct {
+	name  string
+	kinds map[string]bool
+}
+
+// phases enumerates the dependency-ordered install phases; unlisted kinds
+// fall into a final catch-all phase.
+var phases = []phase{
+	{name: "Namespaces", kinds: kindSet("Namespace")},
+	{name: "CRDs", kinds: kindSet("CustomResourceDefinition")},
+	{name: "ServiceAccounts", kinds: kindSet("ServiceAccount")},
+	{name: "RBAC", kinds: kindSet("Role", "ClusterRole")},
+	{name: "RBACBindings", kinds: kindSet("RoleBinding", "ClusterRoleBinding")},
+	{name: "Config", kinds: kindSet("ConfigMap", "Secret")},
+	{name: "Services", kinds: kindSet("Service")},
+	{name: "Workloads", kinds: kindSet("Deployment", "StatefulSet", "DaemonSet", "Job")},
+	{name: "Subscriptions", kinds: kindSet("Subscription", "Channel")},
+}
+
+func kindSet(kinds ...string) map[string]bool {
+	set := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		set[k] = true
+	}
+	return set
+}
+
+// Apply installs pre-install hooks, then resources in dependency-ordered
+// phases, then post-install hooks.
+func Apply(ctx context.Context, c runtimeclient.Client, resources []*unstructured.Unstructured) error {
+	preInstall, resources, postInstall := partitionByHook(resources)
+
+	if err := applyPhase(ctx, c, "PreInstall", preInstall); err != nil {
+		return err
+	}
+
+	byKind := make(map[string][]*unstructured.Unstructured)
+	for _, res := range resources {
+		byKind[res.GetKind()] = append(byKind[res.GetKind()], res)
+	}
+
+	for _, ph := range phases {
+		var objs []*unstructured.Unstructured
+		for kind := range ph.kinds {
+			objs = append(objs, byKind[kind]...)
+			delete(byKind, kind)
+		}
+		if err := applyPhase(ctx, c, ph.name, objs); err != nil {
+			return err
+		}
+	}
+
+	// Anything left over wasn't assigned a phase; apply it before
+	// post-install hooks so Apply never silently drops a resource.
+	var rest []*unstructured.Unstructured
+	for _, objs := range byKind {
+		rest = append(rest, objs...)
+	}
+	if err := applyPhase(ctx, c, "Other", rest); err != nil {
+		return err
+	}
+
+	return applyPhase(ctx, c, "PostInstall", postInstall)
+}
+
+// partitionByHook splits resources into pre-install/post-install hooks and
+// everything else, which runs through the normal phased install.
+func partitionByHook(resources []*unstructured.Unstructured) (preInstall, rest, postInstall []*unstructured.Unstructured) {
+	for _, res := range resources {
+		switch res.GetAnnotations()[annotationHook] {
+		case "pre-install":
+			preInstall = append(preInstall, res)
+		case "post-install":
+			postInstall = append(postInstall, res)
+		default:
+			rest = append(rest, res)
+		}
+	}
+	return preInstall, rest, postInstall
+}
+
+func applyPhase(ctx context.Context, c runtimeclient.Client, name string, objs []*unstructured.Unstructured) error {
+	if len(objs) == 0 {
+		return nil
+	}
+	log.Info("Applying phase", "phase", name, "count", len(objs))
+	for _, obj := range objs {
+		if err := applyObject(ctx, c, obj); err != nil {
+			return fmt.Errorf("failed to apply %s %s/%s in phase %s: %w",
+				obj.GetKind(), obj.GetNamespace(), obj.GetName(), name, err)
+		}
+	}
+	if name == "CRDs" {
+		return waitForEstablished(ctx, c, objs)
+	}
+	return nil
+}
+
+// applyObject installs obj per its apply-mode annotation.
+func applyObject(ctx context.Context, c runtimeclient.Client, obj *unstructured.Unstructured) error {
+	switch obj.GetAnnotations()[annotationApplyMode] {
+	case "create-only":
+		if err := c.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	case "patch":
+		return c.Patch(ctx, obj, runtimeclient.Merge, runtimeclient.FieldOwner(fieldManager))
+	default:
+		return serverSideApply(ctx, c, obj)
+	}
+}
+
+func serverSideApply(ctx context.Context, c runtimeclient.Client, obj *unstructured.Unstructured) error {
+	return c.Patch(ctx, obj, runtimeclient.Apply, runtimeclient.ForceOwnership, runtimeclient.FieldOwner(fieldManager))
+}
+
+// waitForEstablished blocks until every CRD in objs reports Established=True.
+func waitForEstablished(ctx context.Context, c runtimeclient.Client, crds []*unstructured.Unstructured) error {
+	return wait.PollImmediate(2*time.Second, crdEstablishedTimeout, func() (bool, error) {
+		for _, crd := range crds {
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(crd.GroupVersionKind())
+			key := runtimeclient.ObjectKeyFromObject(crd)
+			if err := c.Get(ctx, key, current); err != nil {
+				return false, err
+			}
+			if !isEstablished(current) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func isEstablished(crd *unstructured.Unstructured) bool {
+	conditions, found, err := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	if err != nil || !found {
+		return false
+	}
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
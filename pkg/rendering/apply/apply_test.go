@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package apply
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func withKind(name, kind string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+	}}
+	u.SetName(name)
+	return u
+}
+
+func withHook(name, kind, hook string) *unstructured.Unstructured {
+	u := withKind(name, kind)
+	u.SetAnnotations(map[string]string{annotationHook: hook})
+	return u
+}
+
+func TestPartitionByHook(t *testing.T) {
+	pre := withHook("pre", "Job", "pre-install")
+	post := withHook("post", "Job", "post-install")
+	plain := withKind("plain", "ConfigMap")
+
+	gotPre, gotRest, gotPost := partitionByHook([]*unstructured.Unstructured{pre, plain, post})
+
+	if len(gotPre) != 1 || gotPre[0].GetName() != "pre" {
+		t.Errorf("preInstall = %+v, want just %q", gotPre, "pre")
+	}
+	if len(gotPost) != 1 || gotPost[0].GetName() != "post" {
+		t.Errorf("postInstall = %+v, want just %q", gotPost, "post")
+	}
+	if len(gotRest) != 1 || gotRest[0].GetName() != "plain" {
+		t.Errorf("rest = %+v, want just %q", gotRest, "plain")
+	}
+}
+
+// orderTrackingClient records, in order, the name of every object applied
+// through Patch (server-side-apply/patch modes) or Create (create-only
+// mode), returns createErr from Create, and reports any CRD it's asked for as
+// already Established.
+type orderTrackingClient struct {
+	runtimeclient.Client
+	applied   *[]string
+	createErr error
+}
+
+func (c orderTrackingClient) Patch(_ context.Context, obj runtimeclient.Object, _ runtimeclient.Patch, _ ...runtimeclient.PatchOption) error {
+	*c.applied = append(*c.applied, obj.GetName())
+	return nil
+}
+
+func (c orderTrackingClient) Create(_ context.Context, obj runtimeclient.Object, _ ...runtimeclient.CreateOption) error {
+	*c.applied = append(*c.applied, obj.GetName())
+	return c.createErr
+}
+
+func (c orderTrackingClient) Get(_ context.Context, _ runtimeclient.ObjectKey, obj runtimeclient.Object, _ ...runtimeclient.GetOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	u.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Established", "status": "True"},
+		},
+	}
+	return nil
+}
+
+func TestApply_PhaseOrdering(t *testing.T) {
+	var applied []string
+	c := orderTrackingClient{applied: &applied}
+
+	resources := []*unstructured.Unstructured{
+		withKind("web", "Deployment"),
+		withKind("crd", "CustomResourceDefinition"),
+		withKind("ns", "Namespace"),
+		withKind("role", "ClusterRole"),
+		withHook("setup", "Job", "pre-install"),
+	}
+
+	if err := Apply(context.Background(), c, resources); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []string{"setup", "ns", "crd", "role", "web"}
+	if len(applied) != len(want) {
+		t.Fatalf("applied = %v, want %v", applied, want)
+	}
+	for i, name := range want {
+		if applied[i] != name {
+			t.Errorf("applied[%d] = %q, want %q (full order %v)", i, applied[i], name, applied)
+		}
+	}
+}
+
+func TestApplyObject_CreateOnlyIgnoresAlreadyExists(t *testing.T) {
+	obj := withKind("cm", "ConfigMap")
+	obj.SetAnnotations(map[string]string{annotationApplyMode: "create-only"})
+
+	var applied []string
+	c := orderTrackingClient{
+		applied:   &applied,
+		createErr: apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "cm"),
+	}
+
+	if err := applyObject(context.Background(), c, obj); err != nil {
+		t.Fatalf("applyObject() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0] != "cm" {
+		t.Errorf("applied = %v, want [cm]", applied)
+	}
+}
@@ -4,14 +4,20 @@
 package rendering
 
 import (
+	"context"
+	"fmt"
 	"strconv"
+	"strings"
 
 	operatorsv1 "github.com/stolostron/multiclusterhub-operator/api/v1"
+	"github.com/stolostron/multiclusterhub-operator/pkg/rendering/apply"
 	"github.com/stolostron/multiclusterhub-operator/pkg/rendering/templates"
 	"github.com/stolostron/multiclusterhub-operator/pkg/utils"
 	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/kustomize/v3/pkg/resource"
@@ -21,14 +27,53 @@ var log = logf.Log.WithName("renderer")
 
 type renderFn func(*resource.Resource) (*unstructured.Unstructured, error)
 
+// ResourcePath is a Kind plus a nested field path to stamp installer labels onto.
+type ResourcePath struct {
+	Group   string
+	Version string
+	Kind    string
+	Path    []string
+}
+
+// workloadLabelPaths enumerates the embedded PodTemplate/JobTemplate paths
+// that also need the MCH ownership labels.
+var workloadLabelPaths = []ResourcePath{
+	{Kind: "Deployment", Path: []string{"spec", "template", "metadata", "labels"}},
+	{Kind: "StatefulSet", Path: []string{"spec", "template", "metadata", "labels"}},
+	{Kind: "DaemonSet", Path: []string{"spec", "template", "metadata", "labels"}},
+	{Kind: "ReplicaSet", Path: []string{"spec", "template", "metadata", "labels"}},
+	{Kind: "Job", Path: []string{"spec", "template", "metadata", "labels"}},
+	{Kind: "CronJob", Path: []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"}},
+}
+
+// selectorLabelPaths enumerates the selector paths that must also carry the
+// object's labels (the installer label included) so the selector keeps
+// matching the pod template labels stamped above.
+var selectorLabelPaths = []ResourcePath{
+	{Kind: "Deployment", Path: []string{"spec", "selector", "matchLabels"}},
+	{Kind: "StatefulSet", Path: []string{"spec", "selector", "matchLabels"}},
+	{Kind: "DaemonSet", Path: []string{"spec", "selector", "matchLabels"}},
+	{Kind: "ReplicaSet", Path: []string{"spec", "selector", "matchLabels"}},
+	{Kind: "Job", Path: []string{"spec", "selector", "matchLabels"}},
+}
+
 // Renderer is a Kustomizee Renderer Factory
 type Renderer struct {
-	cr        *operatorsv1.MultiClusterHub
-	renderFns map[string]renderFn
+	cr           *operatorsv1.MultiClusterHub
+	renderFns    map[string]renderFn
+	transformers []registeredTransformer
 }
 
-// NewRenderer Initializes a Kustomize Renderer Factory
-func NewRenderer(multipleClusterHub *operatorsv1.MultiClusterHub) *Renderer {
+// podSpecTransformerKinds are the workload Kinds whose PodTemplateSpec lives
+// at the fixed spec.template path the built-in transformers below assume.
+// CronJob nests its PodTemplateSpec under spec.jobTemplate.spec.template
+// instead, so it's left out rather than silently no-op'd.
+var podSpecTransformerKinds = ForKinds("Deployment", "StatefulSet", "DaemonSet", "Job", "ReplicaSet")
+
+// NewRenderer Initializes a Kustomize Renderer Factory. imageDigests maps an
+// image repository reference to the sha256 digest ImageOverrideTransformer
+// should pin it to; pass nil to skip digest pinning.
+func NewRenderer(multipleClusterHub *operatorsv1.MultiClusterHub, imageDigests map[string]string) *Renderer {
 	renderer := &Renderer{
 		cr: multipleClusterHub,
 	}
@@ -43,21 +88,139 @@ func NewRenderer(multipleClusterHub *operatorsv1.MultiClusterHub) *Renderer {
 		"StatefulSet":              renderer.renderNamespace,
 		"Channel":                  renderer.renderNamespace,
 		"CustomResourceDefinition": renderer.renderCRD,
+		"DaemonSet":                renderer.renderNamespace,
+		"Job":                      renderer.renderNamespace,
+		"CronJob":                  renderer.renderNamespace,
+		"ReplicaSet":               renderer.renderNamespace,
 	}
+	renderer.RegisterTransformer(podSpecTransformerKinds, &ImageOverrideTransformer{ImageDigests: imageDigests})
+	renderer.RegisterTransformer(podSpecTransformerKinds, PodSpecOverridesTransformer{})
+	renderer.RegisterTransformer(podSpecTransformerKinds, ConfigHashAnnotationTransformer{})
 	return renderer
 }
 
-// Render renders Templates under TEMPLATES_PATH
-func (r *Renderer) Render(c runtimeclient.Client) ([]*unstructured.Unstructured, error) {
+// multiclusterhubComponent is the component key GetTemplates() renders
+// under; Render uses it to invalidate the cached overlay by the same key.
+const multiclusterhubComponent = "multiclusterhub"
+
+// Render renders Templates under TEMPLATES_PATH, enhancing each with owner
+// labels/namespace as appropriate for apply. Objects whose GVK isn't
+// registered on the target cluster are held back and returned as deferred
+// rather than failing the whole render.
+func (r *Renderer) Render(c runtimeclient.Client) (resources []*unstructured.Unstructured, deferred []*unstructured.Unstructured, err error) {
+	tr := templates.GetTemplateRenderer()
+	tr.InvalidateIfChanged(multiclusterhubComponent, fmt.Sprintf("%+v", r.cr.Spec.Overrides))
+
+	templates, err := tr.GetTemplates()
+	if err != nil {
+		return nil, nil, err
+	}
+	uobjs, err := r.renderTemplates(templates)
+	if err != nil {
+		return nil, nil, err
+	}
+	resources, deferred, err = partitionByGVKAvailability(c, uobjs)
+	if err != nil {
+		return nil, nil, err
+	}
+	resources, err = filterSkippedByAnnotation(c, resources)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resources, deferred, nil
+}
+
+// Install renders and installs the MCH resources via pkg/rendering/apply,
+// logging any deferred (GVK not yet registered) resources instead of failing.
+func (r *Renderer) Install(ctx context.Context, c runtimeclient.Client) error {
+	resources, deferred, err := r.Render(c)
+	if err != nil {
+		return err
+	}
+	for _, d := range deferred {
+		log.Info("Deferring resource: GVK not yet registered", "kind", d.GetKind(), "name", d.GetName())
+	}
+	return apply.Apply(ctx, c, resources)
+}
+
+// defaultChannel is the overlay channel RenderComponent renders.
+const defaultChannel = "stable"
+
+// RenderComponent renders a single MCH component's kustomize overlay, e.g.
+// "search" from TEMPLATES_PATH/search/overlays/stable; version only keys the
+// cache and does not select the overlay directory. It always renders the
+// defaultChannel overlay; no channel is read from the MultiClusterHub CR. It
+// invalidates that component's cached overlay whenever r.cr.Spec.Overrides
+// has changed since the last render, so the overlay is re-read from disk
+// instead of returning a stale ResMap.
+func (r *Renderer) RenderComponent(component, version string) ([]*unstructured.Unstructured, error) {
+	tr := templates.GetTemplateRenderer()
+	tr.InvalidateIfChanged(component, fmt.Sprintf("%+v", r.cr.Spec.Overrides))
+
+	resources, err := tr.GetTemplatesFor(component, version, defaultChannel)
+	if err != nil {
+		return nil, err
+	}
+	return r.renderTemplates(resources)
+}
+
+// RenderForDeletion renders Templates under TEMPLATES_PATH for delete,
+// resolving namespace the way renderNamespace does but skipping
+// label/transformer enhancement and dropping (rather than deferring) objects
+// whose GVK isn't registered on the cluster.
+func (r *Renderer) RenderForDeletion(c runtimeclient.Client) ([]*unstructured.Unstructured, error) {
 	templates, err := templates.GetTemplateRenderer().GetTemplates()
 	if err != nil {
 		return nil, err
 	}
-	resources, err := r.renderTemplates(templates)
+	uobjs := r.renderTemplatesForDeletion(templates)
+	resources, _, err := partitionByGVKAvailability(c, uobjs)
 	if err != nil {
 		return nil, err
 	}
-	return resources, nil
+	return filterSkippedByAnnotation(c, resources)
+}
+
+// namespacedRenderKinds lists the Kinds renderNamespace substitutes a namespace for.
+var namespacedRenderKinds = map[string]bool{
+	"Deployment": true, "Service": true, "ServiceAccount": true, "ConfigMap": true,
+	"Subscription": true, "StatefulSet": true, "Channel": true, "DaemonSet": true,
+	"Job": true, "CronJob": true, "ReplicaSet": true,
+}
+
+func (r *Renderer) renderTemplatesForDeletion(templates []*resource.Resource) []*unstructured.Unstructured {
+	uobjs := make([]*unstructured.Unstructured, 0, len(templates))
+	for _, template := range templates {
+		res := template.DeepCopy()
+		if namespacedRenderKinds[res.GetKind()] {
+			u := &unstructured.Unstructured{Object: res.Map()}
+			if UpdateNamespace(u) {
+				res.SetNamespace(r.cr.Namespace)
+			}
+		}
+		uobjs = append(uobjs, &unstructured.Unstructured{Object: res.Map()})
+	}
+	return uobjs
+}
+
+// partitionByGVKAvailability splits uobjs into resources whose GVK is
+// registered on the target cluster and deferred resources whose GVK isn't,
+// using the client's RESTMapper the same way controller-runtime does to
+// resolve a REST mapping before issuing a request.
+func partitionByGVKAvailability(c runtimeclient.Client, uobjs []*unstructured.Unstructured) (resources, deferred []*unstructured.Unstructured, err error) {
+	for _, uobj := range uobjs {
+		gvk := uobj.GroupVersionKind()
+		_, err := c.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				deferred = append(deferred, uobj)
+				continue
+			}
+			return nil, nil, err
+		}
+		resources = append(resources, uobj)
+	}
+	return resources, deferred, nil
 }
 
 func (r *Renderer) renderTemplates(templates []*resource.Resource) ([]*unstructured.Unstructured, error) {
@@ -75,6 +238,9 @@ func (r *Renderer) renderTemplates(templates []*resource.Resource) ([]*unstructu
 		if uobj == nil {
 			continue
 		}
+		if err := r.runTransformers(uobj); err != nil {
+			return []*unstructured.Unstructured{}, err
+		}
 		uobjs = append(uobjs, uobj)
 
 	}
@@ -89,7 +255,91 @@ func (r *Renderer) renderNamespace(res *resource.Resource) (*unstructured.Unstru
 		res.SetNamespace(r.cr.Namespace)
 	}
 
-	return &unstructured.Unstructured{Object: res.Map()}, nil
+	u = &unstructured.Unstructured{Object: res.Map()}
+	utils.AddInstallerLabel(u, r.cr.GetName(), r.cr.GetNamespace())
+	propagateInstallerLabel(u)
+
+	return u, nil
+}
+
+// propagateInstallerLabel stamps every label on the object's metadata (the
+// installer label included) onto the embedded PodTemplate/selector paths that
+// apply to the object's Kind, so pods spawned from these templates remain
+// selectable. The installer label value is a
+// deterministic function of the CR name/namespace, so reapplying it to
+// StatefulSet's immutable spec.volumeClaimTemplates on every reconcile is a
+// no-op against the API server rather than a rejected write.
+func propagateInstallerLabel(u *unstructured.Unstructured) {
+	labels := u.GetLabels()
+	if len(labels) == 0 {
+		return
+	}
+
+	kind := u.GetKind()
+	for _, rp := range workloadLabelPaths {
+		if rp.Kind != kind {
+			continue
+		}
+		mergeNestedStringMap(u, rp.Path, labels)
+	}
+	for _, rp := range selectorLabelPaths {
+		if rp.Kind != kind {
+			continue
+		}
+		mergeNestedStringMap(u, rp.Path, labels)
+	}
+	if kind == "StatefulSet" {
+		propagateVolumeClaimTemplateLabels(u, labels)
+	}
+}
+
+// volumeClaimTemplatesPath locates a StatefulSet's embedded VCT list.
+var volumeClaimTemplatesPath = []string{"spec", "volumeClaimTemplates"}
+
+// propagateVolumeClaimTemplateLabels merges labels into the metadata.labels
+// of each entry under volumeClaimTemplatesPath.
+func propagateVolumeClaimTemplateLabels(u *unstructured.Unstructured, labels map[string]string) {
+	vcts, found, err := unstructured.NestedSlice(u.Object, volumeClaimTemplatesPath...)
+	if err != nil || !found {
+		return
+	}
+	for i, v := range vcts {
+		vct, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		existing, found, err := unstructured.NestedStringMap(vct, "metadata", "labels")
+		if err != nil || !found {
+			existing = map[string]string{}
+		}
+		for k, v := range labels {
+			existing[k] = v
+		}
+		if err := unstructured.SetNestedStringMap(vct, existing, "metadata", "labels"); err != nil {
+			log.Error(err, "Failed to propagate installer label onto volumeClaimTemplate")
+			continue
+		}
+		vcts[i] = vct
+	}
+	if err := unstructured.SetNestedSlice(u.Object, vcts, volumeClaimTemplatesPath...); err != nil {
+		log.Error(err, "Failed to propagate installer label onto volumeClaimTemplates")
+	}
+}
+
+// mergeNestedStringMap merges labels into the string map found at path,
+// leaving the object untouched if the path doesn't resolve to a map (e.g.
+// the object has no PodTemplate).
+func mergeNestedStringMap(u *unstructured.Unstructured, path []string, labels map[string]string) {
+	existing, found, err := unstructured.NestedStringMap(u.Object, path...)
+	if err != nil || !found {
+		existing = map[string]string{}
+	}
+	for k, v := range labels {
+		existing[k] = v
+	}
+	if err := unstructured.SetNestedStringMap(u.Object, existing, path...); err != nil {
+		log.Error(err, "Failed to propagate installer label", "path", path)
+	}
 }
 
 func (r *Renderer) renderClusterRole(res *resource.Resource) (*unstructured.Unstructured, error) {
@@ -136,15 +386,56 @@ func (r *Renderer) renderCRD(res *resource.Resource) (*unstructured.Unstructured
 
 // UpdateNamespace checks for annotiation to update NS
 func UpdateNamespace(u *unstructured.Unstructured) bool {
-	metadata, ok := u.Object["metadata"].(map[string]interface{})
 	updateNamespace := true
-	if ok {
-		annotations, ok := metadata["annotations"].(map[string]string)
-		if ok {
-			if annotations["update-namespace"] != "" {
-				updateNamespace, _ = strconv.ParseBool(annotations["update-namespace"])
+	// Unstructured objects hold annotations as map[string]interface{}, which
+	// GetAnnotations converts; asserting the raw field straight to
+	// map[string]string never matches.
+	if v, ok := u.GetAnnotations()["update-namespace"]; ok && v != "" {
+		updateNamespace, _ = strconv.ParseBool(v)
+	}
+	return updateNamespace
+}
+
+// Annotations the renderer honors from the kustomize base.
+const (
+	// AnnotationSkipIfCRDMissing, set to "<group>/<kind>", drops the
+	// resource if that CRD isn't registered on the target cluster.
+	AnnotationSkipIfCRDMissing = "mch.open-cluster-management.io/skip-if-crd-missing"
+
+	// AnnotationApplyMode controls how pkg/rendering/apply installs a
+	// resource: "create-only", "server-side-apply" (default), or "patch".
+	AnnotationApplyMode = "mch.open-cluster-management.io/apply-mode"
+
+	// AnnotationHook gates when pkg/rendering/apply installs a resource:
+	// "pre-install" or "post-install". A resource marked "pre-delete" is
+	// installed with the ordinary phases; apply has no delete path.
+	AnnotationHook = "mch.open-cluster-management.io/hook"
+)
+
+// filterSkippedByAnnotation drops objects whose AnnotationSkipIfCRDMissing CRD isn't registered.
+func filterSkippedByAnnotation(c runtimeclient.Client, uobjs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	kept := make([]*unstructured.Unstructured, 0, len(uobjs))
+	for _, uobj := range uobjs {
+		ref, ok := uobj.GetAnnotations()[AnnotationSkipIfCRDMissing]
+		if !ok || ref == "" {
+			kept = append(kept, uobj)
+			continue
+		}
+		group, kind, ok := strings.Cut(ref, "/")
+		if !ok {
+			log.Info("Ignoring malformed skip-if-crd-missing annotation", "value", ref)
+			kept = append(kept, uobj)
+			continue
+		}
+		if _, err := c.RESTMapper().RESTMappings(schema.GroupKind{Group: group, Kind: kind}); err != nil {
+			if meta.IsNoMatchError(err) {
+				log.Info("Skipping resource: dependency CRD not installed",
+					"kind", uobj.GetKind(), "name", uobj.GetName(), "dependency", ref)
+				continue
 			}
+			return nil, err
 		}
+		kept = append(kept, uobj)
 	}
-	return updateNamespace
+	return kept, nil
 }
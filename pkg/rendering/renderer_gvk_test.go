@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rendering
+
+import (
+	"testing"
+
+	operatorsv1 "github.com/stolostron/multiclusterhub-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+// fakeRESTMapper only registers the GroupKinds in registered; everything
+// else returns a meta.NoKindMatchError, like an unregistered CRD would.
+type fakeRESTMapper struct {
+	meta.RESTMapper
+	registered map[schema.GroupKind]bool
+}
+
+func (f fakeRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	if !f.registered[gk] {
+		return nil, &meta.NoKindMatchError{GroupKind: gk}
+	}
+	return &meta.RESTMapping{}, nil
+}
+
+func (f fakeRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	if !f.registered[gk] {
+		return nil, &meta.NoKindMatchError{GroupKind: gk}
+	}
+	return []*meta.RESTMapping{{}}, nil
+}
+
+type fakeClient struct {
+	runtimeclient.Client
+	mapper meta.RESTMapper
+}
+
+func (f fakeClient) RESTMapper() meta.RESTMapper { return f.mapper }
+
+func unstructuredWithKind(kind string, annotations map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+	}}
+	u.SetName("test-" + kind)
+	if annotations != nil {
+		u.SetAnnotations(annotations)
+	}
+	return u
+}
+
+func TestPartitionByGVKAvailability(t *testing.T) {
+	c := fakeClient{mapper: fakeRESTMapper{registered: map[schema.GroupKind]bool{
+		{Group: "", Kind: "ConfigMap"}: true,
+	}}}
+
+	uobjs := []*unstructured.Unstructured{
+		unstructuredWithKind("ConfigMap", nil),
+		unstructuredWithKind("FooCRD", nil),
+	}
+
+	resources, deferred, err := partitionByGVKAvailability(c, uobjs)
+	if err != nil {
+		t.Fatalf("partitionByGVKAvailability() error = %v", err)
+	}
+	if len(resources) != 1 || resources[0].GetKind() != "ConfigMap" {
+		t.Errorf("resources = %+v, want only the registered ConfigMap", resources)
+	}
+	if len(deferred) != 1 || deferred[0].GetKind() != "FooCRD" {
+		t.Errorf("deferred = %+v, want only the unregistered FooCRD", deferred)
+	}
+}
+
+func TestFilterSkippedByAnnotation(t *testing.T) {
+	c := fakeClient{mapper: fakeRESTMapper{registered: map[schema.GroupKind]bool{
+		{Group: "foo.example.com", Kind: "Bar"}: true,
+	}}}
+
+	kept := unstructuredWithKind("ConfigMap", map[string]string{
+		AnnotationSkipIfCRDMissing: "foo.example.com/Bar",
+	})
+	dropped := unstructuredWithKind("ConfigMap", map[string]string{
+		AnnotationSkipIfCRDMissing: "missing.example.com/Baz",
+	})
+	plain := unstructuredWithKind("ConfigMap", nil)
+
+	got, err := filterSkippedByAnnotation(c, []*unstructured.Unstructured{kept, dropped, plain})
+	if err != nil {
+		t.Fatalf("filterSkippedByAnnotation() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d resources, want 2: %+v", len(got), got)
+	}
+	for _, u := range got {
+		if u == dropped {
+			t.Errorf("expected %s to be dropped, but it was kept", dropped.GetName())
+		}
+	}
+}
+
+func TestRenderTemplatesForDeletion(t *testing.T) {
+	rf := resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl())
+	dep, err := rf.FromMap(map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "console", "namespace": "kustomize-base-namespace"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build fixture resource: %v", err)
+	}
+	clusterRole, err := rf.FromMap(map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRole",
+		"metadata":   map[string]interface{}{"name": "console"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build fixture resource: %v", err)
+	}
+
+	r := &Renderer{cr: &operatorsv1.MultiClusterHub{}}
+	r.cr.SetNamespace("my-mch-ns")
+
+	uobjs := r.renderTemplatesForDeletion([]*resource.Resource{dep, clusterRole})
+	if len(uobjs) != 2 {
+		t.Fatalf("got %d objects, want 2", len(uobjs))
+	}
+	if uobjs[0].GetNamespace() != "my-mch-ns" {
+		t.Errorf("Deployment namespace = %q, want %q", uobjs[0].GetNamespace(), "my-mch-ns")
+	}
+	if uobjs[1].GetNamespace() != "" {
+		t.Errorf("ClusterRole namespace = %q, want unset (cluster-scoped)", uobjs[1].GetNamespace())
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rendering
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUpdateNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		want        bool
+	}{
+		{name: "no annotations", annotations: nil, want: true},
+		{name: "update-namespace false", annotations: map[string]interface{}{"update-namespace": "false"}, want: false},
+		{name: "update-namespace true", annotations: map[string]interface{}{"update-namespace": "true"}, want: true},
+		{name: "update-namespace empty", annotations: map[string]interface{}{"update-namespace": ""}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			metadata := map[string]interface{}{}
+			if tt.annotations != nil {
+				metadata["annotations"] = tt.annotations
+			}
+			u.Object["metadata"] = metadata
+
+			if got := UpdateNamespace(u); got != tt.want {
+				t.Errorf("UpdateNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 	"sync"
 
 	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
@@ -25,12 +26,21 @@ import (
 
 const TemplatesPathEnvVar = "TEMPLATES_PATH"
 
+// baseOverlay is the sentinel channel for components with a single
+// kustomize base rather than per-channel overlays.
+const baseOverlay = "base"
+
 var loadTemplateRendererOnce sync.Once
 var templateRenderer *TemplateRenderer
 
+// TemplateRenderer caches rendered kustomize overlays per component/version/channel.
 type TemplateRenderer struct {
 	templatesPath string
 	templates     map[string]resmap.ResMap
+
+	mu sync.Mutex
+	// overridesFingerprints tracks the last-seen Spec.Overrides fingerprint per component.
+	overridesFingerprints map[string]string
 }
 
 func GetTemplateRenderer() *TemplateRenderer {
@@ -40,21 +50,33 @@ func GetTemplateRenderer() *TemplateRenderer {
 			log.Fatalf("TEMPLATES_PATH environment variable is required")
 		}
 		templateRenderer = &TemplateRenderer{
-			templatesPath: templatesPath,
-			templates:     map[string]resmap.ResMap{},
+			templatesPath:         templatesPath,
+			templates:             map[string]resmap.ResMap{},
+			overridesFingerprints: map[string]string{},
 		}
 	})
 	return templateRenderer
 }
 
+// GetTemplates renders the default multiclusterhub base overlay at the
+// operator's built-in version.
 func (r *TemplateRenderer) GetTemplates() ([]*resource.Resource, error) {
+	return r.GetTemplatesFor("multiclusterhub", version.Version, baseOverlay)
+}
+
+// GetTemplatesFor renders (and caches) the kustomize overlay for a component
+// and channel, e.g. TEMPLATES_PATH/search/overlays/stable. componentVersion
+// is part of the cache key only; it does not select the overlay directory.
+func (r *TemplateRenderer) GetTemplatesFor(component, componentVersion, channel string) ([]*resource.Resource, error) {
 	var err error
-	kind := "multiclusterhub"
-	version := version.Version
-	key := fmt.Sprintf("%s-%s", kind, version)
+	key := templateKey(component, componentVersion, channel)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	resMap, ok := r.templates[key]
 	if !ok {
-		resMap, err = r.render(path.Join(r.templatesPath, kind, "base"))
+		resMap, err = r.render(overlayPath(r.templatesPath, component, channel))
 		if err != nil {
 			return nil, err
 		}
@@ -63,6 +85,36 @@ func (r *TemplateRenderer) GetTemplates() ([]*resource.Resource, error) {
 	return resMap.Resources(), err
 }
 
+// InvalidateIfChanged drops component's cached overlays if fingerprint
+// differs from the last-seen value.
+func (r *TemplateRenderer) InvalidateIfChanged(component, fingerprint string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.overridesFingerprints[component] == fingerprint {
+		return
+	}
+	r.overridesFingerprints[component] = fingerprint
+
+	prefix := component + "-"
+	for key := range r.templates {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.templates, key)
+		}
+	}
+}
+
+func templateKey(component, componentVersion, channel string) string {
+	return fmt.Sprintf("%s-%s-%s", component, componentVersion, channel)
+}
+
+func overlayPath(templatesPath, component, channel string) string {
+	if channel == baseOverlay {
+		return path.Join(templatesPath, component, baseOverlay)
+	}
+	return path.Join(templatesPath, component, "overlays", channel)
+}
+
 func (r *TemplateRenderer) render(kustomizationPath string) (resmap.ResMap, error) {
 	ldr, err := loader.NewLoader(loader.RestrictionRootOnly, validator.NewKustValidator(), kustomizationPath, fs.MakeFsOnDisk())
 	if err != nil {
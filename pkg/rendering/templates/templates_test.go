@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+)
+
+const kustomization = "resources:\n- cm.yaml\n"
+
+func configMapYAML(value string) string {
+	return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test-cm\ndata:\n  value: \"" + value + "\"\n"
+}
+
+func writeBaseOverlay(t *testing.T, templatesPath, component, value string) {
+	t.Helper()
+	dir := filepath.Join(templatesPath, component, baseOverlay)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create overlay dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(kustomization), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization.yaml: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cm.yaml"), []byte(configMapYAML(value)), 0o644); err != nil {
+		t.Fatalf("failed to write cm.yaml: %v", err)
+	}
+}
+
+func newTestRenderer(templatesPath string) *TemplateRenderer {
+	return &TemplateRenderer{
+		templatesPath:         templatesPath,
+		templates:             map[string]resmap.ResMap{},
+		overridesFingerprints: map[string]string{},
+	}
+}
+
+func configMapValue(t *testing.T, r *TemplateRenderer, component, version string) string {
+	t.Helper()
+	resources, err := r.GetTemplatesFor(component, version, baseOverlay)
+	if err != nil {
+		t.Fatalf("GetTemplatesFor() error = %v", err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("got %d resources, want 1", len(resources))
+	}
+	data, ok := resources[0].Map()["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("resource has no data map: %+v", resources[0].Map())
+	}
+	return data["value"].(string)
+}
+
+func TestGetTemplatesFor_CachesAcrossCalls(t *testing.T) {
+	templatesPath := t.TempDir()
+	writeBaseOverlay(t, templatesPath, "multiclusterhub", "v1")
+	r := newTestRenderer(templatesPath)
+
+	if got := configMapValue(t, r, "multiclusterhub", "1.0.0"); got != "v1" {
+		t.Fatalf("initial render = %q, want %q", got, "v1")
+	}
+
+	writeBaseOverlay(t, templatesPath, "multiclusterhub", "v2")
+	if got := configMapValue(t, r, "multiclusterhub", "1.0.0"); got != "v1" {
+		t.Errorf("cached render = %q, want still %q (cache not invalidated)", got, "v1")
+	}
+}
+
+func TestInvalidateIfChanged(t *testing.T) {
+	templatesPath := t.TempDir()
+	writeBaseOverlay(t, templatesPath, "multiclusterhub", "v1")
+	r := newTestRenderer(templatesPath)
+
+	r.InvalidateIfChanged("multiclusterhub", "fp1")
+	if got := configMapValue(t, r, "multiclusterhub", "1.0.0"); got != "v1" {
+		t.Fatalf("initial render = %q, want %q", got, "v1")
+	}
+
+	writeBaseOverlay(t, templatesPath, "multiclusterhub", "v2")
+
+	r.InvalidateIfChanged("multiclusterhub", "fp1")
+	if got := configMapValue(t, r, "multiclusterhub", "1.0.0"); got != "v1" {
+		t.Errorf("render after same fingerprint = %q, want still %q", got, "v1")
+	}
+
+	r.InvalidateIfChanged("multiclusterhub", "fp2")
+	if got := configMapValue(t, r, "multiclusterhub", "1.0.0"); got != "v2" {
+		t.Errorf("render after changed fingerprint = %q, want %q", got, "v2")
+	}
+}
+
+func TestInvalidateIfChanged_LeavesOtherComponentsCached(t *testing.T) {
+	templatesPath := t.TempDir()
+	writeBaseOverlay(t, templatesPath, "multiclusterhub", "v1")
+	writeBaseOverlay(t, templatesPath, "search", "v1")
+	r := newTestRenderer(templatesPath)
+
+	configMapValue(t, r, "multiclusterhub", "1.0.0")
+	configMapValue(t, r, "search", "1.0.0")
+
+	writeBaseOverlay(t, templatesPath, "search", "v2")
+	r.InvalidateIfChanged("multiclusterhub", "changed")
+
+	if got := configMapValue(t, r, "search", "1.0.0"); got != "v1" {
+		t.Errorf("search render = %q, want still %q (unrelated component shouldn't be invalidated)", got, "v1")
+	}
+}
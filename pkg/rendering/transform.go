@@ -0,0 +1,229 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rendering
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	operatorsv1 "github.com/stolostron/multiclusterhub-operator/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Transformer mutates a rendered object in place for per-CR customization.
+type Transformer interface {
+	Transform(u *unstructured.Unstructured, cr *operatorsv1.MultiClusterHub) error
+}
+
+// GVKFilter reports whether a Transformer applies to a given GVK.
+type GVKFilter func(gvk schema.GroupVersionKind) bool
+
+// ForKinds matches any of the given Kinds regardless of Group/Version.
+func ForKinds(kinds ...string) GVKFilter {
+	set := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		set[k] = true
+	}
+	return func(gvk schema.GroupVersionKind) bool {
+		return set[gvk.Kind]
+	}
+}
+
+type registeredTransformer struct {
+	filter      GVKFilter
+	transformer Transformer
+}
+
+// RegisterTransformer adds a Transformer that runs against every rendered
+// object matching filter, after the built-in namespace/label enhancement.
+// Only objects whose Kind has an entry in the renderer's renderFns are
+// transformed; objects of other Kinds pass through unchanged.
+func (r *Renderer) RegisterTransformer(filter GVKFilter, transformer Transformer) {
+	r.transformers = append(r.transformers, registeredTransformer{filter: filter, transformer: transformer})
+}
+
+func (r *Renderer) runTransformers(u *unstructured.Unstructured) error {
+	gvk := u.GroupVersionKind()
+	for _, rt := range r.transformers {
+		if !rt.filter(gvk) {
+			continue
+		}
+		if err := rt.transformer.Transform(u, r.cr); err != nil {
+			return fmt.Errorf("transformer failed for %s %s/%s: %w", gvk.Kind, u.GetNamespace(), u.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// workloadContainerPaths are the PodSpec container list locations the
+// built-in transformers below know how to reach.
+var workloadContainerPaths = [][]string{
+	{"spec", "template", "spec", "containers"},
+	{"spec", "template", "spec", "initContainers"},
+}
+
+// ImageOverrideTransformer rewrites container `image:` fields to the
+// SHA-digest-pinned reference recorded in a release manifest ConfigMap.
+type ImageOverrideTransformer struct {
+	// ImageDigests maps an image repository reference to its pinned sha256 digest.
+	ImageDigests map[string]string
+}
+
+// Transform implements Transformer.
+func (t *ImageOverrideTransformer) Transform(u *unstructured.Unstructured, cr *operatorsv1.MultiClusterHub) error {
+	for _, path := range workloadContainerPaths {
+		if err := t.rewriteContainers(u, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *ImageOverrideTransformer) rewriteContainers(u *unstructured.Unstructured, path []string) error {
+	containers, found, err := unstructured.NestedSlice(u.Object, path...)
+	if err != nil || !found {
+		return err
+	}
+	for i, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		image, ok := container["image"].(string)
+		if !ok {
+			continue
+		}
+		digest, ok := t.ImageDigests[imageRepo(image)]
+		if !ok {
+			continue
+		}
+		container["image"] = fmt.Sprintf("%s@sha256:%s", imageRepo(image), digest)
+		containers[i] = container
+	}
+	return unstructured.SetNestedSlice(u.Object, containers, path...)
+}
+
+// imageRepo strips a :tag or @sha256:digest suffix from image, leaving the
+// bare repository reference used as the ImageDigests lookup key.
+func imageRepo(image string) string {
+	if i := strings.LastIndex(image, "@sha256:"); i != -1 {
+		return image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i != -1 && i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// PodSpecOverridesTransformer injects node placement and image pull
+// configuration from MultiClusterHub.Spec onto every PodTemplateSpec.
+type PodSpecOverridesTransformer struct{}
+
+// Transform implements Transformer.
+func (PodSpecOverridesTransformer) Transform(u *unstructured.Unstructured, cr *operatorsv1.MultiClusterHub) error {
+	path := []string{"spec", "template", "spec"}
+	podSpec, found, err := unstructured.NestedMap(u.Object, path...)
+	if err != nil || !found {
+		return err
+	}
+
+	if len(cr.Spec.NodeSelector) > 0 {
+		nodeSelector := make(map[string]interface{}, len(cr.Spec.NodeSelector))
+		for k, v := range cr.Spec.NodeSelector {
+			nodeSelector[k] = v
+		}
+		podSpec["nodeSelector"] = nodeSelector
+	}
+
+	if len(cr.Spec.Tolerations) > 0 {
+		tolerations, err := toUnstructuredSlice(cr.Spec.Tolerations)
+		if err != nil {
+			return err
+		}
+		podSpec["tolerations"] = tolerations
+	}
+
+	if cr.Spec.ImagePullSecret != "" {
+		existing, found, err := unstructured.NestedSlice(podSpec, "imagePullSecrets")
+		if err != nil {
+			return err
+		}
+		if !found {
+			existing = []interface{}{}
+		}
+		existing = append(existing, map[string]interface{}{"name": cr.Spec.ImagePullSecret})
+		podSpec["imagePullSecrets"] = existing
+	}
+
+	return unstructured.SetNestedMap(u.Object, podSpec, path...)
+}
+
+// toUnstructuredSlice round-trips a typed slice through JSON to get the
+// []interface{} form unstructured.SetNestedMap expects.
+func toUnstructuredSlice(v interface{}) ([]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// configHashAnnotation is stamped onto a PodTemplateSpec with a hash of its own spec.
+const configHashAnnotation = "installer.open-cluster-management.io/config-hash"
+
+// ConfigHashAnnotationTransformer stamps configHashAnnotation onto a
+// PodTemplateSpec so config changes trigger a rolling restart.
+type ConfigHashAnnotationTransformer struct{}
+
+// Transform implements Transformer.
+func (ConfigHashAnnotationTransformer) Transform(u *unstructured.Unstructured, cr *operatorsv1.MultiClusterHub) error {
+	path := []string{"spec", "template"}
+	podTemplate, found, err := unstructured.NestedMap(u.Object, path...)
+	if err != nil || !found {
+		return err
+	}
+
+	hash, err := hashPodSpec(podTemplate)
+	if err != nil {
+		return err
+	}
+
+	annotations, found, err := unstructured.NestedStringMap(podTemplate, "metadata", "annotations")
+	if err != nil {
+		return err
+	}
+	if !found {
+		annotations = map[string]string{}
+	}
+	annotations[configHashAnnotation] = hash
+	if err := unstructured.SetNestedStringMap(podTemplate, annotations, "metadata", "annotations"); err != nil {
+		return err
+	}
+
+	return unstructured.SetNestedMap(u.Object, podTemplate, path...)
+}
+
+func hashPodSpec(podTemplate map[string]interface{}) (string, error) {
+	spec, found, err := unstructured.NestedMap(podTemplate, "spec")
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		spec = map[string]interface{}{}
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
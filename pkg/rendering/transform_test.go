@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rendering
+
+import (
+	"testing"
+
+	operatorsv1 "github.com/stolostron/multiclusterhub-operator/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func deploymentFixture() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "quay.io/stolostron/app:1.2.3"},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func TestImageOverrideTransformer(t *testing.T) {
+	u := deploymentFixture()
+	tr := &ImageOverrideTransformer{ImageDigests: map[string]string{"quay.io/stolostron/app": "deadbeef"}}
+
+	if err := tr.Transform(u, &operatorsv1.MultiClusterHub{}); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	image := containers[0].(map[string]interface{})["image"]
+	want := "quay.io/stolostron/app@sha256:deadbeef"
+	if image != want {
+		t.Errorf("image = %v, want %v", image, want)
+	}
+}
+
+func TestImageOverrideTransformer_NoMatch(t *testing.T) {
+	u := deploymentFixture()
+	tr := &ImageOverrideTransformer{ImageDigests: map[string]string{"quay.io/other/app": "deadbeef"}}
+
+	if err := tr.Transform(u, &operatorsv1.MultiClusterHub{}); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	image := containers[0].(map[string]interface{})["image"]
+	if image != "quay.io/stolostron/app:1.2.3" {
+		t.Errorf("image = %v, want unchanged", image)
+	}
+}
+
+func TestPodSpecOverridesTransformer(t *testing.T) {
+	u := deploymentFixture()
+	cr := &operatorsv1.MultiClusterHub{
+		Spec: operatorsv1.MultiClusterHubSpec{
+			NodeSelector:    map[string]string{"kubernetes.io/os": "linux"},
+			ImagePullSecret: "my-pull-secret",
+		},
+	}
+
+	if err := PodSpecOverridesTransformer{}.Transform(u, cr); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	nodeSelector, found, _ := unstructured.NestedStringMap(u.Object, "spec", "template", "spec", "nodeSelector")
+	if !found || nodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("nodeSelector = %v, found %v", nodeSelector, found)
+	}
+
+	secrets, found, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "imagePullSecrets")
+	if !found || len(secrets) != 1 || secrets[0].(map[string]interface{})["name"] != "my-pull-secret" {
+		t.Errorf("imagePullSecrets = %v, found %v", secrets, found)
+	}
+}
+
+func TestPodSpecOverridesTransformer_Empty(t *testing.T) {
+	u := deploymentFixture()
+
+	if err := PodSpecOverridesTransformer{}.Transform(u, &operatorsv1.MultiClusterHub{}); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	if _, found, _ := unstructured.NestedStringMap(u.Object, "spec", "template", "spec", "nodeSelector"); found {
+		t.Error("nodeSelector should be unset when CR specifies none")
+	}
+}
+
+func TestConfigHashAnnotationTransformer(t *testing.T) {
+	u := deploymentFixture()
+
+	if err := (ConfigHashAnnotationTransformer{}).Transform(u, &operatorsv1.MultiClusterHub{}); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	hash1, _, _ := unstructured.NestedString(u.Object, "spec", "template", "metadata", "annotations", configHashAnnotation)
+	if hash1 == "" {
+		t.Fatal("expected config-hash annotation to be set")
+	}
+
+	containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+	containers[0].(map[string]interface{})["image"] = "quay.io/stolostron/app:2.0.0"
+	if err := unstructured.SetNestedSlice(u.Object, containers, "spec", "template", "spec", "containers"); err != nil {
+		t.Fatalf("failed to mutate fixture: %v", err)
+	}
+
+	if err := (ConfigHashAnnotationTransformer{}).Transform(u, &operatorsv1.MultiClusterHub{}); err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	hash2, _, _ := unstructured.NestedString(u.Object, "spec", "template", "metadata", "annotations", configHashAnnotation)
+	if hash2 == hash1 {
+		t.Error("expected config-hash to change when the PodSpec changes")
+	}
+}